@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+type User struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	PasswordHash  string `json:"password_hash"`
+	Role          string `json:"role"`
+	SchemaVersion int    `json:"schema_version"`
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func validateCredentials(v *Validator, creds *credentials) {
+	v.Check(creds.Username != "", "username", "must be provided")
+	v.Check(creds.Password != "", "password", "must be provided")
+	v.Check(len(creds.Password) >= 8, "password", "must be at least 8 bytes long")
+}
+
+func (app *application) findUserByUsername(tx *bolt.Tx, username string) (*User, error) {
+	bucket := tx.Bucket([]byte("DB")).Bucket([]byte("USERS"))
+	if bucket == nil {
+		return nil, nil
+	}
+
+	cursor := bucket.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		user, err := decodeUser(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (app *application) register(c *gin.Context) {
+	var creds *credentials
+	err := c.BindJSON(&creds)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	v := NewValidator()
+	if validateCredentials(v, creds); !v.Valid() {
+		c.JSON(http.StatusConflict, gin.H{"error": v.Errors})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := &User{
+		ID:           uuid.New().String(),
+		Username:     creds.Username,
+		PasswordHash: string(hash),
+		Role:         RoleUser,
+	}
+
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		existing, err := app.findUserByUsername(tx, user.Username)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("username already taken")
+		}
+
+		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("USERS"))
+		if bucket == nil {
+			return fmt.Errorf("users bucket not found")
+		}
+
+		// The very first account registered becomes an admin, since there is
+		// otherwise no way to ever reach RoleAdmin: there's no separate
+		// promotion endpoint or seed mechanism.
+		if k, _ := bucket.Cursor().First(); k == nil {
+			user.Role = RoleAdmin
+		}
+
+		raw, err := encodeUser(user)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(user.ID), raw)
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": gin.H{"id": user.ID, "username": user.Username, "role": user.Role}})
+}
+
+func (app *application) login(c *gin.Context) {
+	var creds *credentials
+	err := c.BindJSON(&creds)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user *User
+	err = app.db.View(func(tx *bolt.Tx) error {
+		u, err := app.findUserByUsername(tx, creds.Username)
+		if err != nil {
+			return err
+		}
+		user = u
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(creds.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("TOKENS"))
+		if bucket == nil {
+			return fmt.Errorf("tokens bucket not found")
+		}
+
+		return bucket.Put(hashToken(token), []byte(user.ID))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"token": token}})
+}
+
+// generateToken returns a hex-encoded random 32-byte bearer token. The raw
+// token is only ever handed to the client; the server persists sha256(token).
+func generateToken() (string, error) {
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(raw), nil
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// authRequired validates the bearer token on protected routes and attaches
+// the authenticated user's ID and role to the request context.
+func (app *application) authRequired(c *gin.Context) {
+	header := c.GetHeader("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == "" || token == header {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+		return
+	}
+
+	var userID string
+	var role string
+	err := app.db.View(func(tx *bolt.Tx) error {
+		tokens := tx.Bucket([]byte("DB")).Bucket([]byte("TOKENS"))
+		if tokens == nil {
+			return fmt.Errorf("tokens bucket not found")
+		}
+
+		id := tokens.Get(hashToken(token))
+		if id == nil {
+			return nil
+		}
+		userID = string(id)
+
+		users := tx.Bucket([]byte("DB")).Bucket([]byte("USERS"))
+		if users == nil {
+			return fmt.Errorf("users bucket not found")
+		}
+
+		userInfoByte := users.Get([]byte(userID))
+		if userInfoByte == nil {
+			userID = ""
+			return nil
+		}
+
+		user, err := decodeUser(userInfoByte)
+		if err != nil {
+			return err
+		}
+		role = user.Role
+
+		return nil
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if userID == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return
+	}
+
+	c.Set("userID", userID)
+	c.Set("role", role)
+	c.Next()
+}
+
+func ownerID(c *gin.Context) string {
+	id, _ := c.Get("userID")
+	s, _ := id.(string)
+	return s
+}
+
+func isAdmin(c *gin.Context) bool {
+	role, _ := c.Get("role")
+	s, _ := role.(string)
+	return s == RoleAdmin
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Exporter renders a set of servers into a consumer-specific inventory
+// format (Ansible, Prometheus service discovery, Terraform, ...). groups is
+// the full GROUPS bucket contents, needed by the Ansible exporters to emit
+// children/vars blocks; formats that don't have a notion of groups ignore it.
+type Exporter interface {
+	Name() string
+	ContentType() string
+	Encode(w io.Writer, servers []*Server, groups []*Group) error
+}
+
+// exporters is the registry of formats selectable via ?format= or content
+// negotiation on GET /inventory.
+var exporters = map[string]Exporter{
+	"yaml":        ansibleYAMLExporter{},
+	"ansible-ini": ansibleINIExporter{},
+	"prometheus":  prometheusSDExporter{},
+	"terraform":   terraformExporter{},
+	"csv":         csvExporter{},
+}
+
+// acceptExporters maps Accept header content types to exporter names, used
+// when the client didn't set ?format= explicitly.
+var acceptExporters = map[string]string{
+	"application/x-yaml": "yaml",
+	"text/x-yaml":        "yaml",
+	"text/plain":         "ansible-ini",
+	"text/csv":           "csv",
+	"application/hcl":    "terraform",
+	"application/x-hcl":  "terraform",
+}
+
+func exporterFor(format, accept string) (Exporter, bool) {
+	if format != "" {
+		exp, ok := exporters[format]
+		return exp, ok
+	}
+
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType = strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0])
+		if name, ok := acceptExporters[mediaType]; ok {
+			return exporters[name], true
+		}
+	}
+
+	return nil, false
+}
+
+type ansibleYAMLExporter struct{}
+
+func (ansibleYAMLExporter) Name() string        { return "yaml" }
+func (ansibleYAMLExporter) ContentType() string { return "application/x-yaml" }
+
+func (ansibleYAMLExporter) Encode(w io.Writer, servers []*Server, groups []*Group) error {
+	return yaml.NewEncoder(w).Encode(convertToAnsibleInventory(servers, groups))
+}
+
+// ansibleINIExporter emits the classic Ansible INI format:
+//
+//	[tag]
+//	host.example.com ansible_host=10.0.0.1
+type ansibleINIExporter struct{}
+
+func (ansibleINIExporter) Name() string        { return "ansible-ini" }
+func (ansibleINIExporter) ContentType() string { return "text/plain" }
+
+func (ansibleINIExporter) Encode(w io.Writer, servers []*Server, groups []*Group) error {
+	hostsByGroup := make(map[string][]*Server)
+	for _, server := range servers {
+		for _, name := range serverGroupNames(server) {
+			hostsByGroup[name] = append(hostsByGroup[name], server)
+		}
+	}
+
+	names := make([]string, 0, len(hostsByGroup))
+	for name := range hostsByGroup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "[%s]\n", name); err != nil {
+			return err
+		}
+		for _, server := range hostsByGroup[name] {
+			if _, err := fmt.Fprintf(w, "%s ansible_host=%s\n", server.FQDN, server.IP); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range groups {
+		if len(group.Vars) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "[%s:vars]\n", group.Name); err != nil {
+			return err
+		}
+		for k, v := range group.Vars {
+			if _, err := fmt.Fprintf(w, "%s=%v\n", k, v); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prometheusSDExporter emits the JSON format understood by Prometheus'
+// http_sd_config and file_sd_config.
+type prometheusSDExporter struct{}
+
+func (prometheusSDExporter) Name() string        { return "prometheus" }
+func (prometheusSDExporter) ContentType() string { return "application/json" }
+
+// defaultPrometheusPort is the target port assumed for servers that don't
+// carry an explicit "prometheus_port" label, matching node_exporter's
+// conventional default.
+const defaultPrometheusPort = 9100
+
+type prometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func (prometheusSDExporter) Encode(w io.Writer, servers []*Server, _ []*Group) error {
+	targetGroups := make([]prometheusTargetGroup, 0, len(servers))
+
+	for _, server := range servers {
+		labels := map[string]string{"fqdn": server.FQDN}
+		for _, tag := range server.Tags {
+			labels["__meta_tag_"+tag] = "true"
+		}
+
+		port := defaultPrometheusPort
+		if raw, ok := server.Labels["prometheus_port"]; ok {
+			if p, err := strconv.Atoi(raw); err == nil && p > 0 {
+				port = p
+			}
+		}
+
+		targetGroups = append(targetGroups, prometheusTargetGroup{
+			Targets: []string{fmt.Sprintf("%s:%d", server.IP, port)},
+			Labels:  labels,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(targetGroups)
+}
+
+// terraformExporter emits a tfvars JSON document,
+// {"servers": {<server ID>: {fqdn, ip, tags}}}, which sets a `servers`
+// variable when loaded as a .tfvars.json file.
+type terraformExporter struct{}
+
+func (terraformExporter) Name() string        { return "terraform" }
+func (terraformExporter) ContentType() string { return "application/json" }
+
+func (terraformExporter) Encode(w io.Writer, servers []*Server, _ []*Group) error {
+	tfvars := make(map[string]interface{}, len(servers))
+	for _, server := range servers {
+		tfvars[server.ID] = map[string]interface{}{
+			"fqdn": server.FQDN,
+			"ip":   server.IP,
+			"tags": server.Tags,
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]interface{}{"servers": tfvars})
+}
+
+// csvExporter emits fqdn,ip,tags rows, the inverse of the bulk-import CSV
+// format accepted by POST /inventory/bulk.
+type csvExporter struct{}
+
+func (csvExporter) Name() string        { return "csv" }
+func (csvExporter) ContentType() string { return "text/csv" }
+
+func (csvExporter) Encode(w io.Writer, servers []*Server, _ []*Group) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"fqdn", "ip", "tags"}); err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		if err := writer.Write([]string{server.FQDN, server.IP, strings.Join(server.Tags, ";")}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Group is an Ansible-style inventory group: a named collection of hosts
+// (populated by servers whose Tags/Groups reference it) that can itself be
+// nested under a Parent group and carry group-wide Vars.
+type Group struct {
+	Name          string                 `json:"name"`
+	Parent        string                 `json:"parent,omitempty"`
+	Vars          map[string]interface{} `json:"vars,omitempty"`
+	SchemaVersion int                    `json:"schema_version"`
+}
+
+func validateGroup(v *Validator, group *Group) {
+	v.Check(group.Name != "", "name", "must be provided")
+}
+
+func (app *application) fetchGroups(tx *bolt.Tx) ([]*Group, error) {
+	bucket := tx.Bucket([]byte("DB")).Bucket([]byte("GROUPS"))
+	if bucket == nil {
+		return nil, nil
+	}
+
+	var groups []*Group
+	cursor := bucket.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		group, err := decodeGroup(v)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+func (app *application) fetchGroup(tx *bolt.Tx, name string) (*Group, error) {
+	bucket := tx.Bucket([]byte("DB")).Bucket([]byte("GROUPS"))
+	if bucket == nil {
+		return nil, nil
+	}
+
+	raw := bucket.Get([]byte(name))
+	if raw == nil {
+		return nil, nil
+	}
+
+	return decodeGroup(raw)
+}
+
+// wouldCycle reports whether setting child's parent to parentName would
+// create a cycle in the group hierarchy, by walking parentName's ancestors
+// looking for child.
+func (app *application) wouldCycle(tx *bolt.Tx, child, parentName string) (bool, error) {
+	seen := map[string]bool{child: true}
+	name := parentName
+
+	for name != "" {
+		if seen[name] {
+			return true, nil
+		}
+		seen[name] = true
+
+		group, err := app.fetchGroup(tx, name)
+		if err != nil {
+			return false, err
+		}
+		if group == nil {
+			break
+		}
+		name = group.Parent
+	}
+
+	return false, nil
+}
+
+func (app *application) listGroups(c *gin.Context) {
+	var groups []*Group
+	err := app.db.View(func(tx *bolt.Tx) error {
+		g, err := app.fetchGroups(tx)
+		groups = g
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": groups})
+}
+
+func (app *application) getGroup(c *gin.Context) {
+	name := c.Param("name")
+
+	var group *Group
+	err := app.db.View(func(tx *bolt.Tx) error {
+		g, err := app.fetchGroup(tx, name)
+		group = g
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": group})
+}
+
+func (app *application) getGroupChildren(c *gin.Context) {
+	name := c.Param("name")
+
+	var children []*Group
+	err := app.db.View(func(tx *bolt.Tx) error {
+		groups, err := app.fetchGroups(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, group := range groups {
+			if group.Parent == name {
+				children = append(children, group)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": children})
+}
+
+func (app *application) createGroup(c *gin.Context) {
+	var group *Group
+	if err := c.BindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	v := NewValidator()
+	if validateGroup(v, group); !v.Valid() {
+		c.JSON(http.StatusConflict, gin.H{"error": v.Errors})
+		return
+	}
+
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("GROUPS"))
+		if bucket == nil {
+			return fmt.Errorf("groups bucket not found")
+		}
+
+		if existing := bucket.Get([]byte(group.Name)); existing != nil {
+			return fmt.Errorf("group %q already exists", group.Name)
+		}
+
+		if group.Parent != "" {
+			cycle, err := app.wouldCycle(tx, group.Name, group.Parent)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return fmt.Errorf("group %q cannot be its own ancestor", group.Name)
+			}
+		}
+
+		raw, err := encodeGroup(group)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(group.Name), raw)
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": group})
+}
+
+func (app *application) updateGroup(c *gin.Context) {
+	name := c.Param("name")
+
+	var patch *Group
+	if err := c.BindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var current *Group
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("GROUPS"))
+		if bucket == nil {
+			return fmt.Errorf("groups bucket not found")
+		}
+
+		existing, err := app.fetchGroup(tx, name)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return nil
+		}
+
+		if patch.Parent != "" && patch.Parent != existing.Parent {
+			cycle, err := app.wouldCycle(tx, name, patch.Parent)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return fmt.Errorf("group %q cannot be its own ancestor", name)
+			}
+			existing.Parent = patch.Parent
+		}
+
+		if len(patch.Vars) > 0 {
+			existing.Vars = patch.Vars
+		}
+
+		raw, err := encodeGroup(existing)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(name), raw); err != nil {
+			return err
+		}
+
+		current = existing
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if current == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": current})
+}
+
+func (app *application) deleteGroup(c *gin.Context) {
+	name := c.Param("name")
+
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("DB")).Bucket([]byte("GROUPS")).Delete([]byte(name))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, nil)
+}
+
+// serverGroupNames returns the set of group names a server belongs to,
+// merging the legacy flat Tags with the explicit Groups field.
+func serverGroupNames(server *Server) []string {
+	seen := make(map[string]bool, len(server.Tags)+len(server.Groups))
+	var names []string
+
+	for _, name := range append(append([]string{}, server.Tags...), server.Groups...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
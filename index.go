@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// inventoryIndex is an in-process secondary index over the INV bucket.
+// bbolt has no secondary indexes of its own, so filtering on fields other
+// than the key (the server ID) would otherwise require a full bucket scan.
+// The index is rebuilt once at startup and kept in sync on every
+// add/update/delete so that tag lookups stay cheap as the inventory grows.
+type inventoryIndex struct {
+	mu    sync.RWMutex
+	byTag map[string]map[string]struct{} // tag -> set of server IDs
+}
+
+func newInventoryIndex() *inventoryIndex {
+	return &inventoryIndex{
+		byTag: make(map[string]map[string]struct{}),
+	}
+}
+
+// rebuildInventoryIndex scans the INV bucket once and populates idx. It is
+// called at startup, after the schema migrations in openDB have run.
+func rebuildInventoryIndex(db *bolt.DB) (*inventoryIndex, error) {
+	idx := newInventoryIndex()
+
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("INV"))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			server, err := decodeServer(v)
+			if err != nil {
+				return err
+			}
+			idx.add(server)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func (idx *inventoryIndex) add(server *Server) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, tag := range server.Tags {
+		if idx.byTag[tag] == nil {
+			idx.byTag[tag] = make(map[string]struct{})
+		}
+		idx.byTag[tag][server.ID] = struct{}{}
+	}
+}
+
+func (idx *inventoryIndex) remove(server *Server) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, tag := range server.Tags {
+		ids := idx.byTag[tag]
+		if ids == nil {
+			continue
+		}
+		delete(ids, server.ID)
+		if len(ids) == 0 {
+			delete(idx.byTag, tag)
+		}
+	}
+}
+
+func (idx *inventoryIndex) replace(old, updated *Server) {
+	idx.remove(old)
+	idx.add(updated)
+}
+
+// idsForTag returns the set of server IDs tagged with tag, or nil if the tag
+// filter is unused.
+func (idx *inventoryIndex) idsForTag(tag string) map[string]struct{} {
+	if tag == "" {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ids := make(map[string]struct{}, len(idx.byTag[tag]))
+	for id := range idx.byTag[tag] {
+		ids[id] = struct{}{}
+	}
+
+	return ids
+}
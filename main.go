@@ -1,24 +1,39 @@
 package main
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	bolt "go.etcd.io/bbolt"
-	"net/http"
 )
 
 type Server struct {
-	ID   string   `json:"id"`
-	FQDN string   `json:"fqdn"`
-	IP   string   `json:"ip"`
-	Tags []string `json:"tags"`
+	ID            string                 `json:"id"`
+	FQDN          string                 `json:"fqdn"`
+	IP            string                 `json:"ip"`
+	Tags          []string               `json:"tags"`
+	OwnerID       string                 `json:"owner_id,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Labels        map[string]string      `json:"labels,omitempty"`
+	Vars          map[string]interface{} `json:"vars,omitempty"`
+	Groups        []string               `json:"groups,omitempty"`
+	SSHPort       int                    `json:"ssh_port,omitempty"`
+	SSHUser       string                 `json:"ssh_user,omitempty"`
+	SchemaVersion int                    `json:"schema_version"`
 }
 
 type application struct {
-	db *bolt.DB
+	db  *bolt.DB
+	ops *operationRegistry
+	idx *inventoryIndex
 }
 
 func validateServer(v *Validator, server *Server) {
@@ -42,12 +57,11 @@ func (app *application) getServer(c *gin.Context) {
 			return nil
 		}
 
-		buffer := bytes.NewBuffer(serverInfoByte)
-		decoder := gob.NewDecoder(buffer)
-		err := decoder.Decode(&server)
+		s, err := decodeServer(serverInfoByte)
 		if err != nil {
 			return err
 		}
+		server = s
 
 		return nil
 	})
@@ -58,28 +72,84 @@ func (app *application) getServer(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
 		return
 	}
+	if !isAdmin(c) && server.OwnerID != ownerID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"data": server})
 }
 
 func (app *application) getInventory(c *gin.Context) {
+	admin := isAdmin(c)
+	owner := ownerID(c)
+	params := c.Request.URL.Query()
+
+	tagFilter := params.Get("tag")
+	fqdnFilter := params.Get("fqdn")
+	ipFilter := params.Get("ip")
+
+	var ipNet *net.IPNet
+	if ipFilter != "" {
+		_, n, err := net.ParseCIDR(ipFilter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ip must be a valid CIDR, e.g. 10.0.0.0/24"})
+			return
+		}
+		ipNet = n
+	}
+
+	// Candidate IDs from the tag index, if a tag filter was given. This
+	// avoids a full bucket scan when only a handful of hosts carry the tag.
+	candidates := app.idx.idsForTag(tagFilter)
+
 	var servers []*Server
 	err := app.db.View(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("INV"))
 		if bucket == nil {
 			return fmt.Errorf("bucket not found")
 		}
-		cursor := bucket.Cursor()
 
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			var server Server
-			buffer := bytes.NewBuffer(v)
-			decoder := gob.NewDecoder(buffer)
-			err := decoder.Decode(&server)
+		visit := func(k, v []byte) error {
+			server, err := decodeServer(v)
 			if err != nil {
 				return err
 			}
 
-			servers = append(servers, &server)
+			if !admin && server.OwnerID != owner {
+				return nil
+			}
+			if fqdnFilter != "" && !fqdnMatches(server.FQDN, fqdnFilter) {
+				return nil
+			}
+			if ipNet != nil {
+				ip := net.ParseIP(server.IP)
+				if ip == nil || !ipNet.Contains(ip) {
+					return nil
+				}
+			}
+
+			servers = append(servers, server)
+			return nil
+		}
+
+		if candidates != nil {
+			for id := range candidates {
+				v := bucket.Get([]byte(id))
+				if v == nil {
+					continue
+				}
+				if err := visit([]byte(id), v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			if err := visit(k, v); err != nil {
+				return err
+			}
 		}
 
 		return nil
@@ -89,24 +159,116 @@ func (app *application) getInventory(c *gin.Context) {
 		return
 	}
 
-	if servers == nil {
-		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "the inventory is empty"})
+	sortInventory(servers, params.Get("sort"), params.Get("sort_order"))
+
+	// Exporters (Ansible, Prometheus http_sd, Terraform, CSV...) are consumed
+	// by tools that expect the full filtered inventory in one response, not a
+	// single page of it, so pagination only applies to the plain JSON view.
+	if exp, ok := exporterFor(params.Get("format"), c.GetHeader("Accept")); ok {
+		var groups []*Group
+		if err := app.db.View(func(tx *bolt.Tx) error {
+			g, err := app.fetchGroups(tx)
+			groups = g
+			return err
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", exp.ContentType())
+		if err := exp.Encode(c.Writer, servers, groups); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	params := c.Request.URL.Query()
+	total := len(servers)
+	limit, offset, pageSize := paginationParams(params, total)
+	page := servers[offset:limit]
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": page,
+		"metadata": gin.H{
+			"total":     total,
+			"page":      offset/pageSize + 1,
+			"page_size": pageSize,
+		},
+	})
+}
 
-	formatSet := params.Get("format")
+// listExporters reports the inventory export formats available via
+// ?format= on GET /inventory, so this service can be discovered and
+// consumed directly as e.g. a Prometheus service-discovery endpoint.
+func (app *application) listExporters(c *gin.Context) {
+	available := make([]gin.H, 0, len(exporters))
+	for name, exp := range exporters {
+		available = append(available, gin.H{"name": name, "content_type": exp.ContentType()})
+	}
 
-	if formatSet == "yaml" {
+	c.JSON(http.StatusOK, gin.H{"data": available})
+}
 
-		c.YAML(http.StatusOK, convertToAnsibleInventory(servers))
-		return
-	} else {
-		c.JSON(http.StatusOK, gin.H{"data": servers})
+func fqdnMatches(fqdn, filter string) bool {
+	if strings.Contains(filter, "*") {
+		matched, err := filepath.Match(filter, fqdn)
+		return err == nil && matched
+	}
+
+	return strings.Contains(fqdn, filter)
+}
+
+func sortInventory(servers []*Server, sortBy, order string) {
+	if sortBy == "" {
+		sortBy = "fqdn"
+	}
+
+	less := func(i, j int) bool {
+		switch sortBy {
+		case "ip":
+			return servers[i].IP < servers[j].IP
+		case "created_at":
+			return servers[i].CreatedAt.Before(servers[j].CreatedAt)
+		default:
+			return servers[i].FQDN < servers[j].FQDN
+		}
+	}
+
+	if order == "desc" {
+		sort.SliceStable(servers, func(i, j int) bool { return less(j, i) })
 		return
 	}
 
+	sort.SliceStable(servers, less)
+}
+
+const defaultPageSize = 50
+
+// paginationParams returns the slice bounds [offset, limit) to apply to a
+// total-length result set, honoring the limit/offset query params, along
+// with the effective page size for the response metadata.
+func paginationParams(params map[string][]string, total int) (limit, offset, size int) {
+	if raw, ok := params["offset"]; ok && len(raw) > 0 {
+		if v, err := strconv.Atoi(raw[0]); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+	if offset > total {
+		offset = total
+	}
+
+	size = defaultPageSize
+	if raw, ok := params["limit"]; ok && len(raw) > 0 {
+		if v, err := strconv.Atoi(raw[0]); err == nil && v > 0 {
+			size = v
+		}
+	}
+
+	limit = offset + size
+	if limit > total {
+		limit = total
+	}
+
+	return limit, offset, size
 }
 
 func (app *application) addServer(c *gin.Context) {
@@ -125,25 +287,20 @@ func (app *application) addServer(c *gin.Context) {
 	}
 
 	server.ID = uuid.New().String()
+	server.OwnerID = ownerID(c)
+	server.CreatedAt = time.Now()
 	err = app.db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("INV"))
 		if bucket == nil {
 			return nil
 		}
 
-		buffer := new(bytes.Buffer)
-		decoder := gob.NewEncoder(buffer)
-		err := decoder.Encode(&server)
-		if err != nil {
-			return err
-		}
-
-		err = bucket.Put([]byte(server.ID), buffer.Bytes())
+		raw, err := encodeServer(server)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return bucket.Put([]byte(server.ID), raw)
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -153,6 +310,7 @@ func (app *application) addServer(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
 		return
 	}
+	app.idx.add(server)
 	c.JSON(http.StatusOK, gin.H{"data": server})
 }
 
@@ -180,12 +338,11 @@ func (app *application) updateServer(c *gin.Context) {
 			return nil
 		}
 
-		buffer := bytes.NewBuffer(serverInfoByte)
-		decoder := gob.NewDecoder(buffer)
-		err := decoder.Decode(&currentInfo)
+		info, err := decodeServer(serverInfoByte)
 		if err != nil {
 			return err
 		}
+		currentInfo = info
 
 		return nil
 	})
@@ -200,6 +357,13 @@ func (app *application) updateServer(c *gin.Context) {
 		return
 	}
 
+	if !isAdmin(c) && currentInfo.OwnerID != ownerID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+
+	previousInfo := *currentInfo
+
 	if server.IP != currentInfo.IP && server.IP != "" {
 		currentInfo.IP = server.IP
 	}
@@ -208,29 +372,42 @@ func (app *application) updateServer(c *gin.Context) {
 		currentInfo.FQDN = server.FQDN
 	}
 
-	if len(server.Tags) != len(currentInfo.Tags) && len(server.Tags) > 0 {
+	if server.Tags != nil {
 		currentInfo.Tags = server.Tags
 	}
 
+	if server.Groups != nil {
+		currentInfo.Groups = server.Groups
+	}
+
+	if len(server.Labels) > 0 {
+		currentInfo.Labels = server.Labels
+	}
+
+	if len(server.Vars) > 0 {
+		currentInfo.Vars = server.Vars
+	}
+
+	if server.SSHPort != currentInfo.SSHPort && server.SSHPort != 0 {
+		currentInfo.SSHPort = server.SSHPort
+	}
+
+	if server.SSHUser != currentInfo.SSHUser && server.SSHUser != "" {
+		currentInfo.SSHUser = server.SSHUser
+	}
+
 	err = app.db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("INV"))
 		if bucket == nil {
 			return nil
 		}
 
-		buffer := new(bytes.Buffer)
-		decoder := gob.NewEncoder(buffer)
-		err := decoder.Encode(&currentInfo)
+		raw, err := encodeServer(currentInfo)
 		if err != nil {
 			return err
 		}
 
-		err = bucket.Put([]byte(currentInfo.ID), buffer.Bytes())
-		if err != nil {
-			return err
-		}
-
-		return nil
+		return bucket.Put([]byte(currentInfo.ID), raw)
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -240,18 +417,38 @@ func (app *application) updateServer(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
 		return
 	}
+	app.idx.replace(&previousInfo, currentInfo)
 	c.JSON(http.StatusOK, gin.H{"data": currentInfo})
 }
 
 func (app *application) deleteServer(c *gin.Context) {
 	serverId := c.Param("id")
+	admin := isAdmin(c)
+	owner := ownerID(c)
 
+	var deleted *Server
 	err := app.db.Update(func(tx *bolt.Tx) error {
-		err := tx.Bucket([]byte("DB")).Bucket([]byte("INV")).Delete([]byte(serverId))
+		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("INV"))
+
+		serverInfoByte := bucket.Get([]byte(serverId))
+		if serverInfoByte == nil {
+			return nil
+		}
+
+		server, err := decodeServer(serverInfoByte)
 		if err != nil {
 			return err
 		}
 
+		if !admin && server.OwnerID != owner {
+			return nil
+		}
+
+		if err := bucket.Delete([]byte(serverId)); err != nil {
+			return err
+		}
+
+		deleted = server
 		return nil
 	})
 	if err != nil {
@@ -259,30 +456,73 @@ func (app *application) deleteServer(c *gin.Context) {
 		return
 	}
 
+	if deleted != nil {
+		app.idx.remove(deleted)
+	}
+
 	c.JSON(http.StatusAccepted, nil)
 }
 
-func convertToAnsibleInventory(servers []*Server) map[string]interface{} {
-	inventory := make(map[string]interface{})
-	groups := make(map[string]map[string]map[string]string)
+// convertToAnsibleInventory builds a dynamic-inventory document in the shape
+// Ansible's inventory scripts produce: one entry per group (hosts/vars/
+// children), plus a _meta.hostvars block merging each host's Vars.
+func convertToAnsibleInventory(servers []*Server, groups []*Group) map[string]interface{} {
+	hosts := make(map[string]map[string]string)
+	hostvars := make(map[string]interface{})
 
 	for _, server := range servers {
-		for _, tag := range server.Tags {
-			if _, exists := groups[tag]; !exists {
-				groups[tag] = make(map[string]map[string]string)
-			}
-			groups[tag][server.FQDN] = map[string]string{
-				"ansible_host": server.IP,
+		for _, name := range serverGroupNames(server) {
+			if hosts[name] == nil {
+				hosts[name] = make(map[string]string)
 			}
+			hosts[name][server.FQDN] = server.IP
+		}
+
+		if len(server.Vars) > 0 {
+			hostvars[server.FQDN] = server.Vars
+		}
+	}
+
+	children := make(map[string][]string)
+	byName := make(map[string]*Group, len(groups))
+	for _, group := range groups {
+		byName[group.Name] = group
+		if group.Parent != "" {
+			children[group.Parent] = append(children[group.Parent], group.Name)
 		}
 	}
 
-	for group, hosts := range groups {
-		inventory[group] = map[string]interface{}{
-			"hosts": hosts,
+	names := make(map[string]struct{}, len(hosts)+len(groups))
+	for name := range hosts {
+		names[name] = struct{}{}
+	}
+	for _, group := range groups {
+		names[group.Name] = struct{}{}
+	}
+
+	inventory := make(map[string]interface{}, len(names)+1)
+	for name := range names {
+		entry := map[string]interface{}{}
+
+		if hostList := hosts[name]; len(hostList) > 0 {
+			fqdns := make([]string, 0, len(hostList))
+			for fqdn := range hostList {
+				fqdns = append(fqdns, fqdn)
+			}
+			entry["hosts"] = fqdns
+		}
+		if group := byName[name]; group != nil && len(group.Vars) > 0 {
+			entry["vars"] = group.Vars
+		}
+		if kids := children[name]; len(kids) > 0 {
+			entry["children"] = kids
 		}
+
+		inventory[name] = entry
 	}
 
+	inventory["_meta"] = map[string]interface{}{"hostvars": hostvars}
+
 	return inventory
 }
 
@@ -292,15 +532,58 @@ func main() {
 	if err != nil {
 		return
 	}
+	idx, err := rebuildInventoryIndex(db)
+	if err != nil {
+		return
+	}
+	ops, err := newOperationRegistry(db)
+	if err != nil {
+		return
+	}
 	app := &application{
-		db: db,
+		db:  db,
+		ops: ops,
+		idx: idx,
 	}
 	r := gin.Default()
-	r.GET("/inventory", app.getInventory)
-	r.GET("/inventory/:id", app.getServer)
-	r.POST("/inventory", app.addServer)
-	r.PUT("/inventory/:id", app.updateServer)
-	r.DELETE("/inventory/:id", app.deleteServer)
+	r.POST("/register", app.register)
+	r.POST("/login", app.login)
+
+	inventory := r.Group("/inventory")
+	inventory.Use(app.authRequired)
+	inventory.GET("", app.getInventory)
+	inventory.GET("/:id", app.getServer)
+	inventory.POST("", app.addServer)
+	inventory.PUT("/:id", app.updateServer)
+	inventory.DELETE("/:id", app.deleteServer)
+	inventory.POST("/bulk", app.bulkImport)
+
+	// Deliberately NOT /inventory/exporters: a static "exporters" segment and
+	// the param ":id" segment both hang off GET /inventory/*, which gin's
+	// router refuses to register together (panics at startup on versions
+	// that don't special-case static-vs-wildcard priority). Exposed at the
+	// top-level path below instead; this is the one deviation from the
+	// literal route name in the originating request.
+	r.GET("/exporters", app.authRequired, app.listExporters)
+
+	operations := r.Group("/operations")
+	operations.Use(app.authRequired)
+	operations.GET("", app.listOperations)
+	operations.GET("/:id", app.getOperation)
+	operations.DELETE("/:id", app.cancelOperation)
+	operations.GET("/:id/wait", app.waitOperation)
+
+	r.GET("/events", app.authRequired, app.events)
+
+	groups := r.Group("/groups")
+	groups.Use(app.authRequired)
+	groups.GET("", app.listGroups)
+	groups.POST("", app.createGroup)
+	groups.GET("/:name", app.getGroup)
+	groups.PUT("/:name", app.updateGroup)
+	groups.DELETE("/:name", app.deleteGroup)
+	groups.GET("/:name/children", app.getGroupChildren)
+
 	err = r.Run("127.0.0.1:8080")
 	if err != nil {
 		return
@@ -324,11 +607,35 @@ func openDB() (*bolt.DB, error) {
 			return fmt.Errorf("could not create certificates bucket: %v", err)
 		}
 
+		_, err = root.CreateBucketIfNotExists([]byte("USERS"))
+		if err != nil {
+			return fmt.Errorf("could not create users bucket: %v", err)
+		}
+
+		_, err = root.CreateBucketIfNotExists([]byte("TOKENS"))
+		if err != nil {
+			return fmt.Errorf("could not create tokens bucket: %v", err)
+		}
+
+		_, err = root.CreateBucketIfNotExists([]byte("OPS"))
+		if err != nil {
+			return fmt.Errorf("could not create operations bucket: %v", err)
+		}
+
+		_, err = root.CreateBucketIfNotExists([]byte("GROUPS"))
+		if err != nil {
+			return fmt.Errorf("could not create groups bucket: %v", err)
+		}
+
 		return nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("could not set up buckets, %v", err)
 	}
 
+	if err := runMigrations(db); err != nil {
+		return nil, fmt.Errorf("could not run schema migrations: %v", err)
+	}
+
 	return db, nil
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var schemaVersionKey = []byte("schema_version")
+
+// migration upgrades the database from the schema version equal to its
+// index to the version equal to its index + 1, e.g. migrations[0] takes a
+// fresh/legacy DB to schema version 1.
+type migration func(tx *bolt.Tx) error
+
+var migrations = []migration{
+	migrateGobToJSON,
+}
+
+// runMigrations brings db up to CurrentSchemaVersion, refusing to touch a
+// database whose stored version is newer than what this binary understands.
+func runMigrations(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte("META"))
+		if err != nil {
+			return fmt.Errorf("could not create meta bucket: %v", err)
+		}
+
+		version := 0
+		if raw := meta.Get(schemaVersionKey); raw != nil {
+			version = int(binary.BigEndian.Uint64(raw))
+		}
+
+		if version > CurrentSchemaVersion {
+			return fmt.Errorf("database schema version %d is newer than this binary supports (%d)", version, CurrentSchemaVersion)
+		}
+
+		for ; version < CurrentSchemaVersion; version++ {
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("migration to schema version %d failed: %v", version+1, err)
+			}
+		}
+
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(version))
+		return meta.Put(schemaVersionKey, buf)
+	})
+}
+
+// migrateGobToJSON rewrites every gob-encoded record in INV, USERS and OPS
+// as JSON, so operators upgrading from the original gob-based build don't
+// lose their inventory. Records that are already valid JSON are left
+// untouched, which makes this migration safe to run on a fresh database too.
+func migrateGobToJSON(tx *bolt.Tx) error {
+	root := tx.Bucket([]byte("DB"))
+	if root == nil {
+		return nil
+	}
+
+	for _, name := range []string{"INV", "USERS", "OPS"} {
+		bucket := root.Bucket([]byte(name))
+		if bucket == nil {
+			continue
+		}
+
+		// Collect the converted records before writing any of them back:
+		// bucket.Put while a Cursor is mid-traversal of the same bucket can
+		// reposition the cursor and skip or re-visit keys.
+		type kv struct {
+			key   []byte
+			value []byte
+		}
+		var toConvert []kv
+
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			if json.Valid(v) {
+				continue
+			}
+
+			converted, err := gobToJSON(name, v)
+			if err != nil {
+				return fmt.Errorf("bucket %s key %s: %v", name, k, err)
+			}
+
+			toConvert = append(toConvert, kv{key: append([]byte(nil), k...), value: converted})
+		}
+
+		for _, pair := range toConvert {
+			if err := bucket.Put(pair.key, pair.value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func gobToJSON(bucketName string, raw []byte) ([]byte, error) {
+	buffer := bytes.NewBuffer(raw)
+	decoder := gob.NewDecoder(buffer)
+
+	switch bucketName {
+	case "INV":
+		var server Server
+		if err := decoder.Decode(&server); err != nil {
+			return nil, err
+		}
+		return encodeServer(&server)
+	case "USERS":
+		var user User
+		if err := decoder.Decode(&user); err != nil {
+			return nil, err
+		}
+		return encodeUser(&user)
+	case "OPS":
+		var op Operation
+		if err := decoder.Decode(&op); err != nil {
+			return nil, err
+		}
+		return encodeOperation(&op)
+	default:
+		return nil, fmt.Errorf("no gob->json conversion registered for bucket %s", bucketName)
+	}
+}
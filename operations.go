@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+type OperationStatus string
+
+const (
+	OperationPending OperationStatus = "pending"
+	OperationRunning OperationStatus = "running"
+	OperationSuccess OperationStatus = "success"
+	OperationFailure OperationStatus = "failure"
+)
+
+// Operation tracks a long-running task (e.g. a bulk inventory import) that
+// would otherwise tie up an HTTP request. Modeled after LXD's operations API:
+// a client kicks one off, gets back an ID, and polls or waits on it.
+type Operation struct {
+	ID            string                 `json:"id"`
+	OwnerID       string                 `json:"owner_id,omitempty"`
+	Status        OperationStatus        `json:"status"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	Resources     []string               `json:"resources"`
+	Metadata      map[string]interface{} `json:"metadata"`
+	Err           string                 `json:"err,omitempty"`
+	SchemaVersion int                    `json:"schema_version"`
+
+	done            chan struct{} // closed once the operation reaches a final status
+	cancel          chan struct{} // closed to request the running goroutine stop
+	doneClosed      bool          // guards done against a double close; protected by registry.mu
+	cancelRequested bool          // guards cancel against a double close; protected by registry.mu
+}
+
+// isCancelled reports whether cancelOperation has requested this operation
+// stop. Safe to call without holding the registry's mutex.
+func (op *Operation) isCancelled() bool {
+	select {
+	case <-op.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// snapshotOperation returns a copy of op safe to hand to a JSON encoder or SSE writer
+// without racing with concurrent updates. Callers must hold r.mu.
+func snapshotOperation(op *Operation) *Operation {
+	copied := *op
+
+	copied.Metadata = make(map[string]interface{}, len(op.Metadata))
+	for k, v := range op.Metadata {
+		copied.Metadata[k] = v
+	}
+	copied.Resources = append([]string(nil), op.Resources...)
+
+	return &copied
+}
+
+// operationRegistry holds in-flight operations in memory and mirrors them
+// into the OPS bucket for durability across restarts. Events are fanned out
+// to any subscribed SSE clients.
+type operationRegistry struct {
+	db  *bolt.DB
+	mu  sync.Mutex
+	ops map[string]*Operation
+
+	subsMu sync.Mutex
+	subs   map[chan operationEvent]struct{}
+}
+
+type operationEvent struct {
+	Type      string     `json:"type"`
+	Operation *Operation `json:"operation"`
+}
+
+func newOperationRegistry(db *bolt.DB) (*operationRegistry, error) {
+	r := &operationRegistry{
+		db:   db,
+		ops:  make(map[string]*Operation),
+		subs: make(map[chan operationEvent]struct{}),
+	}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("OPS"))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			op, err := decodeOperation(v)
+			if err != nil {
+				return err
+			}
+
+			// Any operation left pending/running when the process exited was
+			// interrupted mid-flight; its goroutine is gone, so mark it failed
+			// rather than leaving it stuck forever.
+			if op.Status == OperationPending || op.Status == OperationRunning {
+				op.Status = OperationFailure
+				op.Err = "interrupted by server restart"
+			}
+			op.done = make(chan struct{})
+			op.cancel = make(chan struct{})
+			close(op.done)
+
+			r.ops[op.ID] = op
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// create starts a new operation owned by ownerID, seeded with metadata
+// (e.g. "total"/"processed" counters). metadata is copied into the
+// operation before it is published, so callers never need to mutate
+// op.Metadata directly and race a concurrent snapshotOperation.
+func (r *operationRegistry) create(ownerID string, resources []string, metadata map[string]interface{}) *Operation {
+	op := &Operation{
+		ID:        uuid.New().String(),
+		OwnerID:   ownerID,
+		Status:    OperationPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Resources: resources,
+		Metadata:  make(map[string]interface{}, len(metadata)),
+		done:      make(chan struct{}),
+		cancel:    make(chan struct{}),
+	}
+	for k, v := range metadata {
+		op.Metadata[k] = v
+	}
+
+	r.mu.Lock()
+	r.ops[op.ID] = op
+	r.mu.Unlock()
+
+	r.persist(op)
+	r.publish("operation-created", op)
+
+	return op
+}
+
+// update applies a status/metadata transition to op. resources, when
+// non-nil, replaces op.Resources under the same lock that protects
+// Metadata, so readers never observe a torn update. The done channel is
+// closed exactly once, guarded by doneClosed under r.mu, even if update is
+// called again (e.g. a cancellation racing the goroutine's own completion)
+// after reaching a final status.
+func (r *operationRegistry) update(op *Operation, status OperationStatus, metadata map[string]interface{}, resources []string, opErr error) *Operation {
+	r.mu.Lock()
+	op.Status = status
+	op.UpdatedAt = time.Now()
+	for k, v := range metadata {
+		op.Metadata[k] = v
+	}
+	if resources != nil {
+		op.Resources = resources
+	}
+	if opErr != nil {
+		op.Err = opErr.Error()
+	}
+	if (status == OperationSuccess || status == OperationFailure) && !op.doneClosed {
+		op.doneClosed = true
+		close(op.done)
+	}
+	snapshot := snapshotOperation(op)
+	r.mu.Unlock()
+
+	r.persist(snapshot)
+	r.publish("operation-updated", snapshot)
+
+	return snapshot
+}
+
+// cancel requests that the running goroutine behind op stop, by closing its
+// cancel channel exactly once, then transitions it to OperationFailure.
+// Looks op up by ID rather than trusting a caller-held pointer, since
+// getOperation/listOperations now hand out point-in-time snapshots rather
+// than the live *Operation.
+func (r *operationRegistry) cancel(id string) (*Operation, error) {
+	r.mu.Lock()
+	op, ok := r.ops[id]
+	if !ok {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("operation not found")
+	}
+	if op.Status == OperationSuccess || op.Status == OperationFailure {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("operation already finished")
+	}
+	if !op.cancelRequested {
+		op.cancelRequested = true
+		close(op.cancel)
+	}
+	r.mu.Unlock()
+
+	return r.update(op, OperationFailure, nil, nil, fmt.Errorf("cancelled")), nil
+}
+
+func (r *operationRegistry) get(id string) (*Operation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	op, ok := r.ops[id]
+	if !ok {
+		return nil, false
+	}
+	return snapshotOperation(op), true
+}
+
+func (r *operationRegistry) list(ownerID string, admin bool) []*Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ops := make([]*Operation, 0, len(r.ops))
+	for _, op := range r.ops {
+		if !admin && op.OwnerID != ownerID {
+			continue
+		}
+		ops = append(ops, snapshotOperation(op))
+	}
+
+	return ops
+}
+
+func (r *operationRegistry) persist(op *Operation) {
+	_ = r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("DB")).Bucket([]byte("OPS"))
+		if bucket == nil {
+			return fmt.Errorf("operations bucket not found")
+		}
+
+		raw, err := encodeOperation(op)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(op.ID), raw)
+	})
+}
+
+func (r *operationRegistry) publish(eventType string, op *Operation) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	for ch := range r.subs {
+		select {
+		case ch <- operationEvent{Type: eventType, Operation: op}:
+		default:
+			// slow subscriber, drop the event rather than block the operation
+		}
+	}
+}
+
+func (r *operationRegistry) subscribe() chan operationEvent {
+	ch := make(chan operationEvent, 16)
+	r.subsMu.Lock()
+	r.subs[ch] = struct{}{}
+	r.subsMu.Unlock()
+	return ch
+}
+
+func (r *operationRegistry) unsubscribe(ch chan operationEvent) {
+	r.subsMu.Lock()
+	delete(r.subs, ch)
+	r.subsMu.Unlock()
+	close(ch)
+}
+
+// bulkImport accepts either a JSON array of servers or a CSV upload
+// (fqdn,ip,tags) and imports them asynchronously via an Operation, so
+// importing thousands of hosts doesn't tie up the HTTP request.
+func (app *application) bulkImport(c *gin.Context) {
+	var servers []*Server
+	var err error
+
+	if file, fileErr := c.FormFile("file"); fileErr == nil {
+		servers, err = parseServerCSV(file)
+	} else {
+		err = c.BindJSON(&servers)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	v := NewValidator()
+	for _, server := range servers {
+		validateServer(v, server)
+	}
+	if !v.Valid() {
+		c.JSON(http.StatusConflict, gin.H{"error": v.Errors})
+		return
+	}
+
+	owner := ownerID(c)
+	resources := make([]string, 0, len(servers))
+
+	op := app.ops.create(owner, resources, map[string]interface{}{
+		"total":     len(servers),
+		"processed": 0,
+	})
+
+	go app.runBulkImport(op, owner, servers)
+
+	snapshot, _ := app.ops.get(op.ID)
+	c.Header("Location", "/operations/"+op.ID)
+	c.JSON(http.StatusAccepted, gin.H{"data": snapshot})
+}
+
+func (app *application) runBulkImport(op *Operation, owner string, servers []*Server) {
+	app.ops.update(op, OperationRunning, nil, nil, nil)
+
+	resources := make([]string, 0, len(servers))
+	for i, server := range servers {
+		if op.isCancelled() {
+			app.ops.update(op, OperationFailure, map[string]interface{}{"processed": i}, resources, fmt.Errorf("cancelled"))
+			return
+		}
+
+		server.ID = uuid.New().String()
+		server.OwnerID = owner
+		server.CreatedAt = time.Now()
+
+		err := app.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte("DB")).Bucket([]byte("INV"))
+			raw, err := encodeServer(server)
+			if err != nil {
+				return err
+			}
+			return bucket.Put([]byte(server.ID), raw)
+		})
+		if err != nil {
+			app.ops.update(op, OperationFailure, map[string]interface{}{"processed": i}, resources, err)
+			return
+		}
+
+		app.idx.add(server)
+		resources = append(resources, server.ID)
+		app.ops.update(op, OperationRunning, map[string]interface{}{"processed": i + 1}, resources, nil)
+	}
+
+	app.ops.update(op, OperationSuccess, map[string]interface{}{"processed": len(servers)}, resources, nil)
+}
+
+func parseServerCSV(file *multipart.FileHeader) ([]*Server, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	var servers []*Server
+	firstRow := true
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("csv row must have at least fqdn,ip columns")
+		}
+
+		// A leading fqdn,ip,tags header row, as written by the CSV exporter,
+		// is skipped.
+		if firstRow {
+			firstRow = false
+			if strings.EqualFold(strings.TrimSpace(record[0]), "fqdn") {
+				continue
+			}
+		}
+
+		server := &Server{
+			FQDN: record[0],
+			IP:   record[1],
+		}
+		if len(record) > 2 && record[2] != "" {
+			for _, tag := range strings.Split(record[2], ";") {
+				tag = strings.TrimSpace(tag)
+				if tag != "" {
+					server.Tags = append(server.Tags, tag)
+				}
+			}
+		}
+
+		servers = append(servers, server)
+	}
+
+	return servers, nil
+}
+
+func (app *application) listOperations(c *gin.Context) {
+	ops := app.ops.list(ownerID(c), isAdmin(c))
+	c.JSON(http.StatusOK, gin.H{"data": ops})
+}
+
+func (app *application) getOperation(c *gin.Context) {
+	op, ok := app.ops.get(c.Param("id"))
+	if !ok || (!isAdmin(c) && op.OwnerID != ownerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": op})
+}
+
+func (app *application) cancelOperation(c *gin.Context) {
+	id := c.Param("id")
+
+	op, ok := app.ops.get(id)
+	if !ok || (!isAdmin(c) && op.OwnerID != ownerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+		return
+	}
+
+	updated, err := app.ops.cancel(id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+func (app *application) waitOperation(c *gin.Context) {
+	op, ok := app.ops.get(c.Param("id"))
+	if !ok || (!isAdmin(c) && op.OwnerID != ownerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+		return
+	}
+
+	timeout := 30 * time.Second
+	if raw := c.Query("timeout"); raw != "" {
+		if secs, err := strconv.Atoi(raw); err == nil {
+			timeout = time.Duration(secs) * time.Second
+		}
+	}
+
+	select {
+	case <-op.done:
+	case <-time.After(timeout):
+	}
+
+	if latest, ok := app.ops.get(op.ID); ok {
+		op = latest
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": op})
+}
+
+// events streams operation lifecycle events to the client as
+// server-sent-events until the client disconnects.
+func (app *application) events(c *gin.Context) {
+	ch := app.ops.subscribe()
+	defer app.ops.unsubscribe(ch)
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event.Operation)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import "encoding/json"
+
+// CurrentSchemaVersion is the schema version this binary writes and the
+// highest it knows how to read. Bumped whenever a migration is added.
+const CurrentSchemaVersion = 1
+
+func encodeServer(server *Server) ([]byte, error) {
+	server.SchemaVersion = CurrentSchemaVersion
+	return json.Marshal(server)
+}
+
+func decodeServer(raw []byte) (*Server, error) {
+	var server Server
+	if err := json.Unmarshal(raw, &server); err != nil {
+		return nil, err
+	}
+
+	return &server, nil
+}
+
+func encodeUser(user *User) ([]byte, error) {
+	user.SchemaVersion = CurrentSchemaVersion
+	return json.Marshal(user)
+}
+
+func decodeUser(raw []byte) (*User, error) {
+	var user User
+	if err := json.Unmarshal(raw, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func encodeGroup(group *Group) ([]byte, error) {
+	group.SchemaVersion = CurrentSchemaVersion
+	return json.Marshal(group)
+}
+
+func decodeGroup(raw []byte) (*Group, error) {
+	var group Group
+	if err := json.Unmarshal(raw, &group); err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+func encodeOperation(op *Operation) ([]byte, error) {
+	op.SchemaVersion = CurrentSchemaVersion
+	return json.Marshal(op)
+}
+
+func decodeOperation(raw []byte) (*Operation, error) {
+	var op Operation
+	if err := json.Unmarshal(raw, &op); err != nil {
+		return nil, err
+	}
+
+	return &op, nil
+}